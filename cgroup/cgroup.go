@@ -0,0 +1,243 @@
+// Package cgroup gives limaq a native view of the Linux cgroup
+// hierarchy: creating sub-cgroups, writing control files, and moving
+// processes into them, all without shelling out to the libcgroup
+// userspace tools (cgcreate/cgset/cgexec/cgdelete/cgsnapshot). Both
+// the legacy per-controller v1 hierarchy and the unified v2 hierarchy
+// are supported; see version.go for how the two are told apart.
+package cgroup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sysfsRoot is a var rather than a const so tests can point it at a
+// temporary directory and exercise the real filesystem operations.
+var sysfsRoot = "/sys/fs/cgroup"
+
+// Controllers are the v1 controllers limaq needs co-mounted so that a
+// single cgroup path controls CPU, memory, block I/O, pids, cpuset,
+// hugetlb, devices, and freezing together. cpuacct is included
+// alongside cpu since it isn't guaranteed to be co-mounted with it
+// (the metrics collector reads cpuacct.usage/cpuacct.stat from it).
+var Controllers = []string{"blkio", "memory", "cpu", "cpuacct", "pids", "cpuset", "hugetlb", "devices", "freezer"}
+
+// Manager is implemented by both the native, sysfs-based Cgroup and
+// the systemd-scope-based Scope, so doRun can pick a driver at runtime
+// via -driver without caring which one it got.
+type Manager interface {
+	Create() error
+	Apply(Resources) error
+	AddProc(pid int) error
+	Procs() ([]string, error)
+	Delete() error
+}
+
+// Cgroup represents a single limaq-managed cgroup, identified by its
+// path relative to the controller mount point, e.g. "limaqcgroup/<uuid>".
+type Cgroup struct {
+	Name string
+}
+
+// New returns a handle for the cgroup at name. It does not touch the
+// filesystem; call Create to actually set it up.
+func New(name string) *Cgroup {
+	return &Cgroup{Name: name}
+}
+
+func controllerPath(controller, name string) string {
+	return filepath.Join(sysfsRoot, controller, name)
+}
+
+// Create creates the cgroup, on v1 under every controller in
+// Controllers, on v2 as a single directory with the required
+// controllers delegated down via cgroup.subtree_control.
+func (c *Cgroup) Create() error {
+	if IsV2() {
+		return c.createV2()
+	}
+
+	for _, ctrl := range Controllers {
+		if err := os.MkdirAll(controllerPath(ctrl, c.Name), 0755); err != nil {
+			return fmt.Errorf("cgroup: create %s/%s: %w", ctrl, c.Name, err)
+		}
+	}
+	return nil
+}
+
+// Delete removes the cgroup. A controller directory that is already
+// gone is not treated as an error.
+func (c *Cgroup) Delete() error {
+	if IsV2() {
+		if err := os.Remove(unifiedPath(c.Name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cgroup: delete %s: %w", c.Name, err)
+		}
+		return nil
+	}
+
+	for _, ctrl := range Controllers {
+		if err := os.Remove(controllerPath(ctrl, c.Name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cgroup: delete %s/%s: %w", ctrl, c.Name, err)
+		}
+	}
+	return nil
+}
+
+// controllerOf returns which controller owns a cgroupfs file key, e.g.
+// "cpu.cfs_quota_us" belongs to the "cpu" controller.
+func controllerOf(key string) string {
+	return strings.SplitN(key, ".", 2)[0]
+}
+
+// set writes each attrs entry to its v1 cgroup control file. Keys are
+// dotted cgroupfs file names such as "cpu.cfs_quota_us" or
+// "memory.limit_in_bytes".
+func (c *Cgroup) set(attrs map[string]interface{}) error {
+	for key, value := range attrs {
+		path := filepath.Join(controllerPath(controllerOf(key), c.Name), key)
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("%v", value)), 0644); err != nil {
+			return fmt.Errorf("cgroup: write %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Resources is the resource configuration limaq can apply to a
+// cgroup, expressed independently of which hierarchy version is
+// mounted. Apply translates it to the right control files.
+type Resources struct {
+	CPUPeriodUS int
+	CPUQuotaUS  int
+	MemoryLimit int64
+	// IOWeight is on the v1 scale of 100-1000; Apply rescales it to
+	// v2's 1-10000 range when needed.
+	IOWeight int
+
+	// PidsMax is the max number of processes/threads allowed in the
+	// cgroup. Zero means unset: no pids limit is applied.
+	PidsMax int64
+	// CpusetCpus and CpusetMems are cpuset.cpus/cpuset.mems values
+	// such as "0-3,7". Empty means unset.
+	CpusetCpus string
+	CpusetMems string
+	// Hugetlb maps a huge page size, e.g. "2MB", to its byte limit.
+	Hugetlb map[string]int64
+	// Devices is the allow/deny rule list for the devices controller,
+	// applied in order against a default-deny policy.
+	Devices []DeviceRule
+}
+
+// Apply writes res to the cgroup's control files, using v1 or v2
+// control files depending on which hierarchy is mounted.
+func (c *Cgroup) Apply(res Resources) error {
+	if IsV2() {
+		return c.applyV2(res)
+	}
+
+	attrs := map[string]interface{}{
+		"cpu.cfs_period_us":     res.CPUPeriodUS,
+		"cpu.cfs_quota_us":      res.CPUQuotaUS,
+		"memory.limit_in_bytes": res.MemoryLimit,
+		"blkio.weight":          res.IOWeight,
+	}
+	if res.PidsMax > 0 {
+		attrs["pids.max"] = res.PidsMax
+	}
+	if res.CpusetCpus != "" {
+		attrs["cpuset.cpus"] = res.CpusetCpus
+	}
+	if res.CpusetMems != "" {
+		attrs["cpuset.mems"] = res.CpusetMems
+	}
+	for size, limit := range res.Hugetlb {
+		attrs[fmt.Sprintf("hugetlb.%s.limit_in_bytes", size)] = limit
+	}
+
+	if err := c.set(attrs); err != nil {
+		return err
+	}
+
+	if len(res.Devices) > 0 {
+		return c.applyDevicesV1(res.Devices)
+	}
+	return nil
+}
+
+// AddProc moves pid into the cgroup. On v1, writing to cgroup.procs
+// under any one of the co-mounted controllers is enough for the
+// kernel to move the process into all of them at once.
+func (c *Cgroup) AddProc(pid int) error {
+	path := filepath.Join(c.procsDir(), "cgroup.procs")
+	return os.WriteFile(path, []byte(strconv.Itoa(pid)), 0644)
+}
+
+// Procs returns the PIDs currently living in the cgroup.
+func (c *Cgroup) Procs() ([]string, error) {
+	path := filepath.Join(c.procsDir(), "cgroup.procs")
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var procs []string
+	for _, proc := range strings.Split(string(src), "\n") {
+		proc = strings.TrimSpace(proc)
+		if proc != "" {
+			procs = append(procs, proc)
+		}
+	}
+	return procs, nil
+}
+
+// procsDir returns the directory holding cgroup.procs for this
+// cgroup: the unified directory on v2, the cpu controller on v1.
+func (c *Cgroup) procsDir() string {
+	if IsV2() {
+		return unifiedPath(c.Name)
+	}
+	return controllerPath("cpu", c.Name)
+}
+
+// List walks the hierarchy under parent and returns every sub-cgroup
+// found there, keyed by its path relative to the controller mount
+// point (v1) or the unified mount point (v2).
+func List(parent string) (map[string]*Cgroup, error) {
+	root := controllerPath("cpu", parent)
+	if IsV2() {
+		root = unifiedPath(parent)
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]*Cgroup{}, nil
+		}
+		return nil, err
+	}
+
+	cgs := make(map[string]*Cgroup)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := filepath.Join(parent, entry.Name())
+		cgs[name] = New(name)
+	}
+	return cgs, nil
+}
+
+// Available reports whether parent already exists as a cgroup, i.e.
+// whether an admin has created and chown'd it for the current user
+// (v1) or it has already been created under the unified mount (v2).
+func Available(parent string) bool {
+	if IsV2() {
+		_, err := os.Stat(unifiedPath(parent))
+		return err == nil
+	}
+
+	_, err := os.Stat(controllerPath("cpu", parent))
+	return err == nil
+}
@@ -0,0 +1,21 @@
+package cgroup
+
+import "testing"
+
+func TestControllerOf(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "cpu.cfs_quota_us", want: "cpu"},
+		{key: "memory.limit_in_bytes", want: "memory"},
+		{key: "hugetlb.2MB.limit_in_bytes", want: "hugetlb"},
+		{key: "blkio.weight", want: "blkio"},
+	}
+
+	for _, tt := range tests {
+		if got := controllerOf(tt.key); got != tt.want {
+			t.Errorf("controllerOf(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
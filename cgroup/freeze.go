@@ -0,0 +1,84 @@
+package cgroup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// State is a cgroup's freezer state, surfaced by status listings.
+type State string
+
+const (
+	// StateFrozen means every process in the cgroup is suspended.
+	StateFrozen State = "frozen"
+	// StateThawed means the freezer file reports the cgroup as not
+	// frozen ("THAWED" on v1, "0" on v2), whether or not it was ever
+	// frozen before.
+	StateThawed State = "thawed"
+	// StateRunning means the cgroup has no freezer file (no freezer
+	// controller delegated to it), or the file holds some other value,
+	// such as v1's transient "FREEZING".
+	StateRunning State = "running"
+)
+
+func (c *Cgroup) freezerPath() string {
+	if IsV2() {
+		return filepath.Join(unifiedPath(c.Name), "cgroup.freeze")
+	}
+	return filepath.Join(controllerPath("freezer", c.Name), "freezer.state")
+}
+
+// Freeze suspends every process in the cgroup via the freezer
+// controller: "FROZEN" on v1, "1" on v2.
+func (c *Cgroup) Freeze() error {
+	value := "FROZEN"
+	if IsV2() {
+		value = "1"
+	}
+	if err := os.WriteFile(c.freezerPath(), []byte(value), 0644); err != nil {
+		return fmt.Errorf("cgroup: freeze %s: %w", c.Name, err)
+	}
+	return nil
+}
+
+// Resume thaws a previously frozen cgroup: "THAWED" on v1, "0" on v2.
+func (c *Cgroup) Resume() error {
+	value := "THAWED"
+	if IsV2() {
+		value = "0"
+	}
+	if err := os.WriteFile(c.freezerPath(), []byte(value), 0644); err != nil {
+		return fmt.Errorf("cgroup: resume %s: %w", c.Name, err)
+	}
+	return nil
+}
+
+// State reports whether the cgroup is frozen, thawed, or running. A
+// missing freezer file (no freezer controller delegated to this
+// cgroup) is reported as StateRunning rather than an error; any other
+// read error is returned.
+func (c *Cgroup) State() (State, error) {
+	src, err := os.ReadFile(c.freezerPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return StateRunning, nil
+		}
+		return "", fmt.Errorf("cgroup: read freezer state of %s: %w", c.Name, err)
+	}
+	return parseFreezerState(string(src)), nil
+}
+
+// parseFreezerState maps the contents of freezer.state (v1) or
+// cgroup.freeze (v2) to a State.
+func parseFreezerState(src string) State {
+	switch strings.TrimSpace(src) {
+	case "FROZEN", "1":
+		return StateFrozen
+	case "THAWED", "0":
+		return StateThawed
+	default:
+		return StateRunning
+	}
+}
@@ -0,0 +1,74 @@
+package cgroup
+
+import "testing"
+
+// withTempSysfsRoot points sysfsRoot at a temporary directory for the
+// duration of the test, so Create/Freeze/Resume/State can be
+// exercised against a real (if fake) filesystem. It's a plain
+// directory tree, not actual cgroupfs, so IsV2 reports false and the
+// v1 code paths run.
+func withTempSysfsRoot(t *testing.T) {
+	t.Helper()
+	orig := sysfsRoot
+	sysfsRoot = t.TempDir()
+	t.Cleanup(func() { sysfsRoot = orig })
+}
+
+// TestFreezeIntegration guards against the class of bug fixed in
+// 8ccfd1e (a controller missing from Controllers, so its control
+// files are never created): it creates a real v1 cgroup and drives
+// Freeze/Resume/State against it, rather than only unit-testing the
+// pure parseFreezerState helper.
+func TestFreezeIntegration(t *testing.T) {
+	withTempSysfsRoot(t)
+
+	cg := New("limaqcgroup/test-uuid")
+	if err := cg.Create(); err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+
+	if state, err := cg.State(); err != nil {
+		t.Fatalf("State before Freeze: %s", err)
+	} else if state != StateRunning {
+		t.Errorf("state before Freeze = %q, want %q", state, StateRunning)
+	}
+
+	if err := cg.Freeze(); err != nil {
+		t.Fatalf("Freeze: %s", err)
+	}
+	if state, err := cg.State(); err != nil {
+		t.Fatalf("State after Freeze: %s", err)
+	} else if state != StateFrozen {
+		t.Errorf("state after Freeze = %q, want %q", state, StateFrozen)
+	}
+
+	if err := cg.Resume(); err != nil {
+		t.Fatalf("Resume: %s", err)
+	}
+	if state, err := cg.State(); err != nil {
+		t.Fatalf("State after Resume: %s", err)
+	} else if state != StateThawed {
+		t.Errorf("state after Resume = %q, want %q", state, StateThawed)
+	}
+}
+
+func TestParseFreezerState(t *testing.T) {
+	tests := []struct {
+		in   string
+		want State
+	}{
+		{in: "FROZEN", want: StateFrozen},
+		{in: "FROZEN\n", want: StateFrozen},
+		{in: "1", want: StateFrozen},
+		{in: "THAWED", want: StateThawed},
+		{in: "0", want: StateThawed},
+		{in: "", want: StateRunning},
+		{in: "FREEZING", want: StateRunning},
+	}
+
+	for _, tt := range tests {
+		if got := parseFreezerState(tt.in); got != tt.want {
+			t.Errorf("parseFreezerState(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
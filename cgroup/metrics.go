@@ -0,0 +1,242 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var metricLabels = []string{"cgroup"}
+
+// Collector is a prometheus.Collector reporting live resource usage
+// for one limaq-managed cgroup: CPU time, memory, block I/O, and PID
+// counts. Modeled on containerd's metrics/cgroups plugin, it reads
+// straight from the cgroup's control files on every scrape and works
+// against both v1 and v2 hierarchies.
+type Collector struct {
+	cg *Cgroup
+
+	cpuUsage    *prometheus.Desc
+	memUsage    *prometheus.Desc
+	memMaxUsage *prometheus.Desc
+	memStat     *prometheus.Desc
+	blkioBytes  *prometheus.Desc
+	pidsCurrent *prometheus.Desc
+	pidsMax     *prometheus.Desc
+}
+
+// NewCollector returns a Collector for cg. Register it with
+// prometheus.MustRegister when the run starts and Unregister it when
+// the run exits.
+func NewCollector(cg *Cgroup) *Collector {
+	return &Collector{
+		cg: cg,
+		cpuUsage: prometheus.NewDesc("limaq_cgroup_cpu_usage_seconds_total",
+			"Cumulative CPU time consumed by the cgroup.", append(append([]string{}, metricLabels...), "cpu", "mode"), nil),
+		memUsage: prometheus.NewDesc("limaq_cgroup_memory_usage_bytes",
+			"Current memory usage of the cgroup.", metricLabels, nil),
+		memMaxUsage: prometheus.NewDesc("limaq_cgroup_memory_max_usage_bytes",
+			"Peak memory usage of the cgroup, if the kernel tracks it.", metricLabels, nil),
+		memStat: prometheus.NewDesc("limaq_cgroup_memory_stat_bytes",
+			"Memory usage broken down by kind (rss/anon, cache/file, swap).", append(append([]string{}, metricLabels...), "kind"), nil),
+		blkioBytes: prometheus.NewDesc("limaq_cgroup_blkio_service_bytes_total",
+			"Bytes transferred to/from block devices.", append(append([]string{}, metricLabels...), "device", "op"), nil),
+		pidsCurrent: prometheus.NewDesc("limaq_cgroup_pids_current",
+			"Number of processes currently in the cgroup.", metricLabels, nil),
+		pidsMax: prometheus.NewDesc("limaq_cgroup_pids_max",
+			"Maximum number of processes allowed in the cgroup (0 if unlimited).", metricLabels, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.cpuUsage
+	ch <- c.memUsage
+	ch <- c.memMaxUsage
+	ch <- c.memStat
+	ch <- c.blkioBytes
+	ch <- c.pidsCurrent
+	ch <- c.pidsMax
+}
+
+// Collect implements prometheus.Collector. Missing control files
+// (e.g. a controller that isn't delegated) are skipped rather than
+// treated as scrape errors, since that's expected depending on flags.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	if IsV2() {
+		c.collectV2(ch)
+		return
+	}
+	c.collectV1(ch)
+}
+
+func readTrimmed(path string) (string, bool) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(src)), true
+}
+
+func readUint(path string) (uint64, bool) {
+	s, ok := readTrimmed(path)
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	return v, err == nil
+}
+
+// readKV parses whitespace-separated "key value" lines, as used by
+// cgroupfs stat files such as memory.stat and cpu.stat.
+func readKV(path string) map[string]uint64 {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	kv := make(map[string]uint64)
+	for _, line := range strings.Split(string(src), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			kv[fields[0]] = v
+		}
+	}
+	return kv
+}
+
+func (c *Collector) collectV1(ch chan<- prometheus.Metric) {
+	name := c.cg.Name
+	label := []string{name}
+
+	if usage, ok := readUint(filepath.Join(controllerPath("cpuacct", name), "cpuacct.usage")); ok {
+		ch <- prometheus.MustNewConstMetric(c.cpuUsage, prometheus.CounterValue,
+			float64(usage)/1e9, append(label, "total", "total")...)
+	}
+	for ctrlMetric, mode := range map[string]string{"user": "user", "system": "system"} {
+		if stat := readKV(filepath.Join(controllerPath("cpuacct", name), "cpuacct.stat")); stat != nil {
+			if v, ok := stat[ctrlMetric]; ok {
+				ch <- prometheus.MustNewConstMetric(c.cpuUsage, prometheus.CounterValue,
+					float64(v)/100.0, append(label, "total", mode)...)
+			}
+		}
+	}
+
+	memDir := controllerPath("memory", name)
+	if v, ok := readUint(filepath.Join(memDir, "memory.usage_in_bytes")); ok {
+		ch <- prometheus.MustNewConstMetric(c.memUsage, prometheus.GaugeValue, float64(v), label...)
+	}
+	if v, ok := readUint(filepath.Join(memDir, "memory.max_usage_in_bytes")); ok {
+		ch <- prometheus.MustNewConstMetric(c.memMaxUsage, prometheus.GaugeValue, float64(v), label...)
+	}
+	if stat := readKV(filepath.Join(memDir, "memory.stat")); stat != nil {
+		for _, kind := range []string{"rss", "cache", "swap"} {
+			if v, ok := stat[kind]; ok {
+				ch <- prometheus.MustNewConstMetric(c.memStat, prometheus.GaugeValue, float64(v), append(label, kind)...)
+			}
+		}
+	}
+
+	blkioPath := filepath.Join(controllerPath("blkio", name), "blkio.throttle.io_service_bytes")
+	if src, err := os.ReadFile(blkioPath); err == nil {
+		for _, line := range strings.Split(string(src), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 3 || fields[1] == "Total" {
+				continue
+			}
+			if v, err := strconv.ParseUint(fields[2], 10, 64); err == nil {
+				ch <- prometheus.MustNewConstMetric(c.blkioBytes, prometheus.CounterValue,
+					float64(v), append(label, fields[0], strings.ToLower(fields[1]))...)
+			}
+		}
+	}
+
+	pidsDir := controllerPath("pids", name)
+	if v, ok := readUint(filepath.Join(pidsDir, "pids.current")); ok {
+		ch <- prometheus.MustNewConstMetric(c.pidsCurrent, prometheus.GaugeValue, float64(v), label...)
+	}
+	if s, ok := readTrimmed(filepath.Join(pidsDir, "pids.max")); ok {
+		if s == "max" {
+			ch <- prometheus.MustNewConstMetric(c.pidsMax, prometheus.GaugeValue, 0, label...)
+		} else if v, err := strconv.ParseUint(s, 10, 64); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.pidsMax, prometheus.GaugeValue, float64(v), label...)
+		}
+	}
+}
+
+func (c *Collector) collectV2(ch chan<- prometheus.Metric) {
+	name := c.cg.Name
+	label := []string{name}
+	dir := unifiedPath(name)
+
+	if stat := readKV(filepath.Join(dir, "cpu.stat")); stat != nil {
+		if v, ok := stat["usage_usec"]; ok {
+			ch <- prometheus.MustNewConstMetric(c.cpuUsage, prometheus.CounterValue, float64(v)/1e6, append(label, "total", "total")...)
+		}
+		if v, ok := stat["user_usec"]; ok {
+			ch <- prometheus.MustNewConstMetric(c.cpuUsage, prometheus.CounterValue, float64(v)/1e6, append(label, "total", "user")...)
+		}
+		if v, ok := stat["system_usec"]; ok {
+			ch <- prometheus.MustNewConstMetric(c.cpuUsage, prometheus.CounterValue, float64(v)/1e6, append(label, "total", "system")...)
+		}
+	}
+
+	if v, ok := readUint(filepath.Join(dir, "memory.current")); ok {
+		ch <- prometheus.MustNewConstMetric(c.memUsage, prometheus.GaugeValue, float64(v), label...)
+	}
+	if v, ok := readUint(filepath.Join(dir, "memory.peak")); ok {
+		ch <- prometheus.MustNewConstMetric(c.memMaxUsage, prometheus.GaugeValue, float64(v), label...)
+	}
+	if stat := readKV(filepath.Join(dir, "memory.stat")); stat != nil {
+		for metric, kind := range map[string]string{"anon": "rss", "file": "cache", "swap": "swap"} {
+			if v, ok := stat[metric]; ok {
+				ch <- prometheus.MustNewConstMetric(c.memStat, prometheus.GaugeValue, float64(v), append(label, kind)...)
+			}
+		}
+	}
+
+	if src, err := os.ReadFile(filepath.Join(dir, "io.stat")); err == nil {
+		for _, line := range strings.Split(string(src), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			device := fields[0]
+			for _, kv := range fields[1:] {
+				parts := strings.SplitN(kv, "=", 2)
+				if len(parts) != 2 {
+					continue
+				}
+				var op string
+				switch parts[0] {
+				case "rbytes":
+					op = "read"
+				case "wbytes":
+					op = "write"
+				default:
+					continue
+				}
+				if v, err := strconv.ParseUint(parts[1], 10, 64); err == nil {
+					ch <- prometheus.MustNewConstMetric(c.blkioBytes, prometheus.CounterValue, float64(v), append(label, device, op)...)
+				}
+			}
+		}
+	}
+
+	if v, ok := readUint(filepath.Join(dir, "pids.current")); ok {
+		ch <- prometheus.MustNewConstMetric(c.pidsCurrent, prometheus.GaugeValue, float64(v), label...)
+	}
+	if s, ok := readTrimmed(filepath.Join(dir, "pids.max")); ok {
+		if s == "max" {
+			ch <- prometheus.MustNewConstMetric(c.pidsMax, prometheus.GaugeValue, 0, label...)
+		} else if v, err := strconv.ParseUint(s, 10, 64); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.pidsMax, prometheus.GaugeValue, float64(v), label...)
+		}
+	}
+}
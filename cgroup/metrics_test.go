@@ -0,0 +1,47 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadKV(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "memory.stat")
+	content := "rss 1048576\ncache 2097152\nswap 0\nmalformed line\nbadvalue notanumber\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readKV(path)
+	want := map[string]uint64{"rss": 1048576, "cache": 2097152, "swap": 0}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readKV(%q) = %v, want %v", path, got, want)
+	}
+}
+
+func TestReadKVMissingFile(t *testing.T) {
+	if got := readKV(filepath.Join(t.TempDir(), "does-not-exist")); got != nil {
+		t.Errorf("readKV(missing) = %v, want nil", got)
+	}
+}
+
+func TestReadUint(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "pids.current")
+	if err := os.WriteFile(path, []byte("42\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	v, ok := readUint(path)
+	if !ok || v != 42 {
+		t.Errorf("readUint(%q) = (%d, %v), want (42, true)", path, v, ok)
+	}
+
+	if _, ok := readUint(filepath.Join(dir, "missing")); ok {
+		t.Errorf("readUint(missing) = ok, want !ok")
+	}
+}
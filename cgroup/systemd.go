@@ -0,0 +1,162 @@
+package cgroup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	godbus "github.com/godbus/dbus/v5"
+)
+
+// Scope manages resource limits for one limaq run as a transient
+// systemd scope unit instead of manipulating /sys/fs/cgroup directly.
+// Talking to systemd over its private dbus socket lets rootless users
+// get working resource limits on systemd-managed distros without an
+// admin pre-creating and chowning a parent cgroup, the same way
+// podman and runc delegate pod-level limits on systemd hosts.
+type Scope struct {
+	name  string
+	conn  *dbus.Conn
+	props []dbus.Property
+}
+
+// NewScope returns a handle for the scope named limaq-<id>.scope. It
+// does not talk to systemd yet; call Create to open the dbus
+// connection.
+func NewScope(id string) *Scope {
+	return &Scope{name: fmt.Sprintf("limaq-%s.scope", id)}
+}
+
+// Create opens a connection to the caller's systemd user instance
+// over its private dbus socket.
+func (s *Scope) Create() error {
+	conn, err := dbus.NewUserConnectionContext(context.Background())
+	if err != nil {
+		return fmt.Errorf("cgroup: connect to systemd: %w", err)
+	}
+	s.conn = conn
+	return nil
+}
+
+// Apply stages resource properties to hand to systemd when the scope
+// starts; systemd itself writes the equivalent v1/v2 control files.
+// cpuset and hugetlb limits, and device-deny rules, have no faithful
+// systemd unit property equivalent, so Apply rejects them instead of
+// silently dropping them.
+func (s *Scope) Apply(res Resources) error {
+	if res.CpusetCpus != "" || res.CpusetMems != "" {
+		return fmt.Errorf("cgroup: -driver=systemd does not support -cpuset-cpus/-cpuset-mems")
+	}
+	if len(res.Hugetlb) > 0 {
+		return fmt.Errorf("cgroup: -driver=systemd does not support -hugetlb-limit")
+	}
+	for _, d := range res.Devices {
+		if !d.Allow {
+			return fmt.Errorf("cgroup: -driver=systemd does not support -device-deny (systemd units only express device allow-lists)")
+		}
+		if d.Type != "b" && d.Type != "c" {
+			return fmt.Errorf("cgroup: -driver=systemd does not support device type %q, only \"b\" and \"c\"", d.Type)
+		}
+	}
+
+	cpuQuotaPerSec := uint64(res.CPUQuotaUS) * 1000000 / uint64(res.CPUPeriodUS)
+
+	s.props = append(s.props,
+		dbus.PropDescription("limaq resource-limited run"),
+		newProperty("CPUQuotaPerSecUSec", cpuQuotaPerSec),
+		newProperty("MemoryMax", uint64(res.MemoryLimit)),
+		newProperty("IOWeight", uint64(rescaleIOWeight(res.IOWeight))),
+	)
+
+	if res.PidsMax > 0 {
+		s.props = append(s.props, newProperty("TasksMax", uint64(res.PidsMax)))
+	}
+
+	if len(res.Devices) > 0 {
+		s.props = append(s.props, newProperty("DevicePolicy", "strict"))
+		for _, d := range res.Devices {
+			kind := "char"
+			if d.Type == "b" {
+				kind = "block"
+			}
+			s.props = append(s.props, newProperty("DeviceAllow",
+				fmt.Sprintf("%s-%s:%s %s", kind, d.Major, d.Minor, d.Access)))
+		}
+	}
+
+	return nil
+}
+
+func newProperty(name string, value interface{}) dbus.Property {
+	return dbus.Property{Name: name, Value: godbus.MakeVariant(value)}
+}
+
+// AddProc starts the transient scope with pid as its sole initial
+// member, under the caller's user.slice/user@<uid>.service.
+func (s *Scope) AddProc(pid int) error {
+	props := append([]dbus.Property{dbus.PropPids(uint32(pid))}, s.props...)
+
+	ch := make(chan string, 1)
+	if _, err := s.conn.StartTransientUnitContext(context.Background(), s.name, "fail", props, ch); err != nil {
+		return fmt.Errorf("cgroup: start transient scope %s: %w", s.name, err)
+	}
+	<-ch
+	return nil
+}
+
+// controlGroup asks systemd which cgroup path it placed the scope in.
+func (s *Scope) controlGroup() (string, error) {
+	prop, err := s.conn.GetUnitPropertyContext(context.Background(), s.name, "ControlGroup")
+	if err != nil {
+		return "", fmt.Errorf("cgroup: query scope %s control group: %w", s.name, err)
+	}
+
+	cgpath, ok := prop.Value.Value().(string)
+	if !ok {
+		return "", fmt.Errorf("cgroup: unexpected ControlGroup property for scope %s", s.name)
+	}
+	return cgpath, nil
+}
+
+// Procs returns the PIDs currently living in the scope's cgroup.
+func (s *Scope) Procs() ([]string, error) {
+	cgpath, err := s.controlGroup()
+	if err != nil {
+		return nil, err
+	}
+
+	file := filepath.Join(sysfsRoot, cgpath, "cgroup.procs")
+	if !IsV2() {
+		file = filepath.Join(sysfsRoot, "cpu", cgpath, "cgroup.procs")
+	}
+
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var procs []string
+	for _, proc := range strings.Split(string(src), "\n") {
+		proc = strings.TrimSpace(proc)
+		if proc != "" {
+			procs = append(procs, proc)
+		}
+	}
+	return procs, nil
+}
+
+// Delete stops the scope, which systemd cleans up along with its
+// cgroup, and closes the dbus connection.
+func (s *Scope) Delete() error {
+	ch := make(chan string, 1)
+	if _, err := s.conn.StopUnitContext(context.Background(), s.name, "fail", ch); err != nil {
+		return fmt.Errorf("cgroup: stop scope %s: %w", s.name, err)
+	}
+	<-ch
+
+	s.conn.Close()
+	return nil
+}
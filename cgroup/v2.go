@@ -0,0 +1,116 @@
+package cgroup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// v2Controllers are the unified-hierarchy controllers corresponding to
+// Controllers; "blkio" becomes "io" under v2, "cpuacct" and "freezer"
+// have no entry (v2 reports CPU usage in cpu.stat and freezes through
+// cgroup.freeze), and "devices" has no v2 controller of its own (it's
+// emulated via applyDevicesV2 instead).
+var v2Controllers = []string{"io", "memory", "cpu", "pids", "cpuset", "hugetlb"}
+
+func unifiedPath(name string) string {
+	return filepath.Join(sysfsRoot, name)
+}
+
+// createV2 creates the cgroup directory and delegates the required
+// controllers down to it by writing "+<controller>" to
+// cgroup.subtree_control on every ancestor, from the root down.
+func (c *Cgroup) createV2() error {
+	dir := sysfsRoot
+	for _, elem := range strings.Split(c.Name, string(filepath.Separator)) {
+		if err := enableControllers(dir); err != nil {
+			return err
+		}
+		dir = filepath.Join(dir, elem)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("cgroup: create %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// enableControllers requests v2Controllers be delegated to dir's
+// children via cgroup.subtree_control. It is not an error for a
+// controller to already be enabled.
+func enableControllers(dir string) error {
+	var req strings.Builder
+	for _, ctrl := range v2Controllers {
+		fmt.Fprintf(&req, "+%s ", ctrl)
+	}
+
+	path := filepath.Join(dir, "cgroup.subtree_control")
+	if err := os.WriteFile(path, []byte(strings.TrimSpace(req.String())), 0644); err != nil {
+		return fmt.Errorf("cgroup: enable controllers on %s: %w", dir, err)
+	}
+	return nil
+}
+
+// rescaleIOWeight converts an io weight from limaq's v1 scale of
+// 100-1000 to v2's io.weight scale of 1-10000.
+func rescaleIOWeight(v1Weight int) int {
+	const (
+		v1Min, v1Max = 100, 1000
+		v2Min, v2Max = 1, 10000
+	)
+	return v2Min + (v1Weight-v1Min)*(v2Max-v2Min)/(v1Max-v1Min)
+}
+
+// applyV2 writes res to the unified control files: cpu.max combines
+// the period and quota limaq used to write separately on v1,
+// memory.max replaces memory.limit_in_bytes, and io.weight replaces
+// blkio.weight after rescaling, and hugetlb.<size>.max replaces
+// hugetlb.<size>.limit_in_bytes. cpuset.cpus/mems and pids.max keep
+// their v1 names; devices is emulated separately since v2 has no
+// devices.allow/devices.deny.
+func (c *Cgroup) applyV2(res Resources) error {
+	dir := unifiedPath(c.Name)
+
+	cpuMax := fmt.Sprintf("%d %d", res.CPUQuotaUS, res.CPUPeriodUS)
+	if err := os.WriteFile(filepath.Join(dir, "cpu.max"), []byte(cpuMax), 0644); err != nil {
+		return fmt.Errorf("cgroup: write cpu.max: %w", err)
+	}
+
+	memMax := strconv.FormatInt(res.MemoryLimit, 10)
+	if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(memMax), 0644); err != nil {
+		return fmt.Errorf("cgroup: write memory.max: %w", err)
+	}
+
+	ioWeight := strconv.Itoa(rescaleIOWeight(res.IOWeight))
+	if err := os.WriteFile(filepath.Join(dir, "io.weight"), []byte(ioWeight), 0644); err != nil {
+		return fmt.Errorf("cgroup: write io.weight: %w", err)
+	}
+
+	if res.PidsMax > 0 {
+		if err := os.WriteFile(filepath.Join(dir, "pids.max"), []byte(strconv.FormatInt(res.PidsMax, 10)), 0644); err != nil {
+			return fmt.Errorf("cgroup: write pids.max: %w", err)
+		}
+	}
+	if res.CpusetCpus != "" {
+		if err := os.WriteFile(filepath.Join(dir, "cpuset.cpus"), []byte(res.CpusetCpus), 0644); err != nil {
+			return fmt.Errorf("cgroup: write cpuset.cpus: %w", err)
+		}
+	}
+	if res.CpusetMems != "" {
+		if err := os.WriteFile(filepath.Join(dir, "cpuset.mems"), []byte(res.CpusetMems), 0644); err != nil {
+			return fmt.Errorf("cgroup: write cpuset.mems: %w", err)
+		}
+	}
+	for size, limit := range res.Hugetlb {
+		path := filepath.Join(dir, fmt.Sprintf("hugetlb.%s.max", size))
+		if err := os.WriteFile(path, []byte(strconv.FormatInt(limit, 10)), 0644); err != nil {
+			return fmt.Errorf("cgroup: write %s: %w", path, err)
+		}
+	}
+
+	if len(res.Devices) > 0 {
+		return c.applyDevicesV2(res.Devices)
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package cgroup
+
+import "testing"
+
+func TestRescaleIOWeight(t *testing.T) {
+	tests := []struct {
+		in   int
+		want int
+	}{
+		{in: 100, want: 1},
+		{in: 1000, want: 10000},
+		{in: 550, want: 5000}, // midpoint of the v1 range
+	}
+
+	for _, tt := range tests {
+		if got := rescaleIOWeight(tt.in); got != tt.want {
+			t.Errorf("rescaleIOWeight(%d) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
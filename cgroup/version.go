@@ -0,0 +1,19 @@
+package cgroup
+
+import "syscall"
+
+// cgroup2SuperMagic is CGROUP2_SUPER_MAGIC from linux/magic.h, the
+// f_type statfs(2) reports for the unified cgroup v2 hierarchy.
+const cgroup2SuperMagic = 0x63677270
+
+// IsV2 reports whether the unified (v2) cgroup hierarchy is mounted at
+// /sys/fs/cgroup, as opposed to the legacy per-controller v1 mounts.
+// On distros that only mount v2 (Fedora, Debian 11+, Ubuntu 22.04+),
+// there is no per-controller "cpu", "memory", etc. directory to use.
+func IsV2() bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(sysfsRoot, &st); err != nil {
+		return false
+	}
+	return int64(st.Type) == cgroup2SuperMagic
+}
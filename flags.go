@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ushitora-anqou/limaq/cgroup"
+)
+
+// repeatableFlag collects every occurrence of a flag.Value flag, e.g.
+// -hugetlb-limit can be given multiple times to build up a limit list.
+type repeatableFlag []string
+
+func (f *repeatableFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *repeatableFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// rawDeviceRule is one "-device-allow"/"-device-deny" occurrence,
+// still unparsed, tagged with which of the two flags produced it.
+type rawDeviceRule struct {
+	spec  string
+	allow bool
+}
+
+// deviceRuleFlag appends to a single shared slice regardless of
+// whether it's bound to -device-allow or -device-deny, so the rules
+// come out in the order the user actually gave them on the command
+// line instead of grouped by flag.
+type deviceRuleFlag struct {
+	rules *[]rawDeviceRule
+	allow bool
+}
+
+func (f *deviceRuleFlag) String() string { return "" }
+
+func (f *deviceRuleFlag) Set(value string) error {
+	*f.rules = append(*f.rules, rawDeviceRule{spec: value, allow: f.allow})
+	return nil
+}
+
+// parseHugetlbLimit parses a "-hugetlb-limit" value of the form
+// "<size>=<bytes>", e.g. "2MB=1073741824".
+func parseHugetlbLimit(s string) (size string, limit int64, err error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 {
+		return "", 0, fmt.Errorf("-hugetlb-limit must be SIZE=BYTES, got %q", s)
+	}
+
+	limit, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("-hugetlb-limit %q: %w", s, err)
+	}
+	return parts[0], limit, nil
+}
+
+// parseDeviceRule parses a "-device-allow"/"-device-deny" value of
+// the form "type major:minor rwm", e.g. "c 1:3 rw" or "a *:* rwm".
+func parseDeviceRule(s string, allow bool) (cgroup.DeviceRule, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 3 {
+		return cgroup.DeviceRule{}, fmt.Errorf("device rule must be \"type major:minor rwm\", got %q", s)
+	}
+
+	majorMinor := strings.SplitN(fields[1], ":", 2)
+	if len(majorMinor) != 2 {
+		return cgroup.DeviceRule{}, fmt.Errorf("device rule %q: major:minor must be MAJOR:MINOR", s)
+	}
+
+	return cgroup.DeviceRule{
+		Type:   fields[0],
+		Major:  majorMinor[0],
+		Minor:  majorMinor[1],
+		Access: fields[2],
+		Allow:  allow,
+	}, nil
+}
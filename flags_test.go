@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ushitora-anqou/limaq/cgroup"
+)
+
+func TestParseHugetlbLimit(t *testing.T) {
+	tests := []struct {
+		in        string
+		wantSize  string
+		wantLimit int64
+		wantErr   bool
+	}{
+		{in: "2MB=1073741824", wantSize: "2MB", wantLimit: 1073741824},
+		{in: "1GB=0", wantSize: "1GB", wantLimit: 0},
+		{in: "2MB", wantErr: true},
+		{in: "2MB=not-a-number", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		size, limit, err := parseHugetlbLimit(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseHugetlbLimit(%q) = nil error, want error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseHugetlbLimit(%q) unexpected error: %s", tt.in, err)
+			continue
+		}
+		if size != tt.wantSize || limit != tt.wantLimit {
+			t.Errorf("parseHugetlbLimit(%q) = (%q, %d), want (%q, %d)", tt.in, size, limit, tt.wantSize, tt.wantLimit)
+		}
+	}
+}
+
+func TestParseDeviceRule(t *testing.T) {
+	tests := []struct {
+		in      string
+		allow   bool
+		want    cgroup.DeviceRule
+		wantErr bool
+	}{
+		{
+			in:    "c 1:3 rw",
+			allow: true,
+			want:  cgroup.DeviceRule{Type: "c", Major: "1", Minor: "3", Access: "rw", Allow: true},
+		},
+		{
+			in:    "a *:* rwm",
+			allow: false,
+			want:  cgroup.DeviceRule{Type: "a", Major: "*", Minor: "*", Access: "rwm", Allow: false},
+		},
+		{in: "c 1 rw", wantErr: true},
+		{in: "c 1-3 rw", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDeviceRule(tt.in, tt.allow)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseDeviceRule(%q) = nil error, want error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseDeviceRule(%q) unexpected error: %s", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseDeviceRule(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -4,176 +4,167 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/user"
-	"regexp"
 	"strings"
 
 	"github.com/google/uuid"
 	"github.com/jaypipes/ghw"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/ushitora-anqou/limaq/cgroup"
 )
 
 const parentCgroup = "limaqcgroup"
 
 var flagVerbose bool
+var flagDriver string
+var flagMetricsAddr string
 
-func getCgroupPath(subname string) string {
-	return fmt.Sprintf("%s/%s", parentCgroup, subname)
+func newManager(id string) cgroup.Manager {
+	if flagDriver == "systemd" {
+		return cgroup.NewScope(id)
+	}
+	return cgroup.New(getCgroupPath(id))
 }
 
-func prefixCgroupCnt(path string) string {
-	return fmt.Sprintf("blkio,memory,cpu:%s", path)
+func getCgroupPath(subname string) string {
+	return fmt.Sprintf("%s/%s", parentCgroup, subname)
 }
 
-func execCmd(name string, args ...string) error {
+func runChild(args []string) (*exec.Cmd, error) {
 	if flagVerbose {
 		fmtArgs := make([]string, len(args))
 		for i, arg := range args {
 			fmtArgs[i] = fmt.Sprintf("'%s'", arg)
 		}
-		fmt.Fprintf(os.Stderr, "exec: '%s' %s\n", name, strings.Join(fmtArgs, " "))
+		fmt.Fprintf(os.Stderr, "exec: %s\n", strings.Join(fmtArgs, " "))
 	}
 
-	cmd := exec.Command(name, args...)
+	cmd := exec.Command(args[0], args[1:]...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
-
-func dumpCmd(name string, args ...string) ([]byte, error) {
-	if flagVerbose {
-		fmtArgs := make([]string, len(args))
-		for i, arg := range args {
-			fmtArgs[i] = fmt.Sprintf("'%s'", arg)
-		}
-		fmt.Fprintf(os.Stderr, "dump: '%s' %s\n", name, strings.Join(fmtArgs, " "))
+	if err := cmd.Start(); err != nil {
+		return nil, err
 	}
+	return cmd, nil
+}
 
-	return exec.Command(name, args...).Output()
+func listCgroups() (map[string]*cgroup.Cgroup, error) {
+	return cgroup.List(parentCgroup)
 }
 
-type cgroup struct {
-	name  string
-	procs []string
+func isCgroupsAvailable() bool {
+	return cgroup.Available(parentCgroup)
 }
 
-func listCgroups() (map[string]cgroup, error) {
-	src, err := dumpCmd("cgsnapshot")
+func printStatus() error {
+	cgs, err := listCgroups()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	cgs := make(map[string]cgroup)
-
-	groups := regexp.
-		MustCompile(fmt.Sprintf(`group %s/(........-....-....-....-............) {`, parentCgroup)).
-		FindAllStringSubmatch(string(src), -1)
-	for _, src := range groups {
-		group := src[1]
-		name := getCgroupPath(group)
-
-		if _, ok := cgs[name]; ok { // duplicate.
-			continue
-		}
-
-		file, err := os.Open(fmt.Sprintf("/sys/fs/cgroup/cpu/%s/cgroup.procs", name))
+	for _, cg := range cgs {
+		procs, err := cg.Procs()
 		if err != nil {
-			return nil, err
+			return err
 		}
-		procsSrc, err := ioutil.ReadAll(file)
+		state, err := cg.State()
 		if err != nil {
-			return nil, err
+			return err
 		}
-		procs := strings.Split(string(procsSrc), "\n")
 
-		cg := cgroup{}
-		cg.name = name
+		fmt.Printf("%s [%s]: ", cg.Name, state)
 		for _, proc := range procs {
-			proc = strings.TrimSpace(proc)
-			if proc != "" {
-				cg.procs = append(cg.procs, proc)
-			}
+			fmt.Printf("%s ", proc)
 		}
-
-		cgs[cg.name] = cg
-	}
-
-	return cgs, nil
-}
-
-func isCgroupsAvailable() bool {
-	src, err := dumpCmd("cgsnapshot")
-	if err != nil {
-		return false
+		fmt.Printf("\n")
 	}
 
-	res := regexp.MustCompile(fmt.Sprintf(`group %s {`, parentCgroup)).MatchString(string(src))
-	return res
+	return nil
 }
 
-func printStatus() error {
+// findCgroup returns the single active cgroup whose name contains
+// substr, e.g. a UUID or a prefix of one. It is an error for substr to
+// match zero or more than one cgroup.
+func findCgroup(substr string) (*cgroup.Cgroup, error) {
 	cgs, err := listCgroups()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, cg := range cgs {
-		fmt.Printf("%s: ", cg.name)
-		for _, proc := range cg.procs {
-			fmt.Printf("%s ", proc)
+	var matches []*cgroup.Cgroup
+	for name, cg := range cgs {
+		if strings.Contains(name, substr) {
+			matches = append(matches, cg)
 		}
-		fmt.Printf("\n")
 	}
 
-	return nil
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no cgroup matching %q", substr)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("%q matches %d cgroups, be more specific", substr, len(matches))
+	}
 }
 
-func setCgroupAttrs(cgpath string, attrs map[string]interface{}) error {
-	var args []string
-	for key, value := range attrs {
-		args = append(args, "-r", fmt.Sprintf("%s=%v", key, value))
+func doFreeze(idSubstr string, freeze bool) error {
+	cg, err := findCgroup(idSubstr)
+	if err != nil {
+		return err
+	}
+
+	if freeze {
+		return cg.Freeze()
 	}
-	args = append(args, cgpath)
-	return execCmd("cgset", args...)
+	return cg.Resume()
 }
 
-func doRun(ncores float64, memmb float64, ioWeight int) error {
+func doRun(ncores float64, memmb float64, ioWeight int, extra cgroup.Resources) error {
 	const cfsPeriod = 100000
-	var err error
 
-	uuid, err := uuid.NewRandom()
+	id, err := uuid.NewRandom()
 	if err != nil {
 		return err
 	}
-	cgpath := getCgroupPath(uuid.String())
-	cgcntpath := prefixCgroupCnt(cgpath)
+	cg := newManager(id.String())
 
-	err = execCmd("cgcreate", "-g", cgcntpath)
-	if err != nil {
+	if err := cg.Create(); err != nil {
 		return err
 	}
-	defer execCmd("cgdelete", "-r", cgcntpath)
+	defer cg.Delete()
 
-	err = setCgroupAttrs(cgpath, map[string]interface{}{
-		"cpu.cfs_period_us":     cfsPeriod,
-		"cpu.cfs_quota_us":      int(cfsPeriod * ncores),
-		"memory.limit_in_bytes": int(memmb * 1000000),
-		"blkio.weight":          ioWeight,
-	})
-	if err != nil {
+	if nativeCg, ok := cg.(*cgroup.Cgroup); ok && flagMetricsAddr != "" {
+		collector := cgroup.NewCollector(nativeCg)
+		prometheus.MustRegister(collector)
+		defer prometheus.Unregister(collector)
+	}
+
+	extra.CPUPeriodUS = cfsPeriod
+	extra.CPUQuotaUS = int(cfsPeriod * ncores)
+	extra.MemoryLimit = int64(memmb * 1000000)
+	extra.IOWeight = ioWeight
+
+	if err := cg.Apply(extra); err != nil {
 		return err
 	}
 
-	err = execCmd("cgexec",
-		append([]string{"-g", cgcntpath}, flag.Args()...)...)
+	cmd, err := runChild(flag.Args())
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if err := cg.AddProc(cmd.Process.Pid); err != nil {
+		return err
+	}
+
+	return cmd.Wait()
 }
 
 func doPrune() error {
@@ -183,11 +174,15 @@ func doPrune() error {
 	}
 
 	for name, cg := range cgs {
-		if len(cg.procs) > 0 { // active.
+		procs, err := cg.Procs()
+		if err != nil {
+			return err
+		}
+		if len(procs) > 0 { // active.
 			continue
 		}
-		err = execCmd("cgdelete", "-r", prefixCgroupCnt(name))
-		if err != nil {
+
+		if err := cg.Delete(); err != nil {
 			return err
 		}
 
@@ -197,18 +192,44 @@ func doPrune() error {
 	return nil
 }
 
-func main() {
-	var err error
+// runFreezeCommand implements the "pause"/"resume" subcommands, each
+// taking a single UUID (or substring of one) identifying the cgroup
+// to freeze or thaw.
+func runFreezeCommand(cmd string, args []string, freeze bool) {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	verbose := fs.Bool("verbose", false, "Verbose mode")
+	fs.Parse(args)
+	flagVerbose = *verbose
 
-	if !isCgroupsAvailable() {
-		user, err := user.Current()
-		if err != nil {
-			panic(errors.New("Can't get current user"))
-		}
-		fmt.Fprintf(os.Stderr, "cgroups is not available. Maybe you should run:\n\n\t# cgcreate -a %s -t %s -g blkio,memory,cpu:%s\n\nto create the parent cgroup.\n", user.Username, user.Username, parentCgroup)
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: limaq %s <uuid-or-substring>\n", cmd)
 		os.Exit(1)
 	}
 
+	if err := doFreeze(fs.Arg(0), freeze); err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	// "limaq -- pause ..." forces the literal-workload interpretation,
+	// so a program actually named "pause" or "resume" can still be run
+	// without being mistaken for the subcommand below.
+	if len(os.Args) > 1 && os.Args[1] == "--" {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	} else if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "pause":
+			runFreezeCommand("pause", os.Args[2:], true)
+			return
+		case "resume":
+			runFreezeCommand("resume", os.Args[2:], false)
+			return
+		}
+	}
+
+	var err error
+
 	cpu, err := ghw.CPU()
 	if err != nil {
 		panic(err)
@@ -224,11 +245,49 @@ func main() {
 		"Memory size in MB you want to use")
 	ioWeight := flag.Int("io", 1000,
 		"Relative weight of block I/O access from 100 to 1000")
+	driver := flag.String("driver", "native",
+		`cgroup driver to use: "native" (manipulate /sys/fs/cgroup directly) or "systemd" (talk to systemd over dbus, no pre-created parent cgroup required)`)
 	verbose := flag.Bool("verbose", false, "Verbose mode")
 	showStatus := flag.Bool("stat", false, "Show status")
 	pruneCgroups := flag.Bool("prune", false, "Remove inactive cgroups")
+	metricsAddr := flag.String("metrics-addr", "",
+		"If set, serve Prometheus metrics for this run's cgroup on this address (e.g. :9321); not collected with -driver=systemd")
+	pidsMax := flag.Int64("pids-max", 0,
+		"Max number of processes/threads to allow (0 means unlimited)")
+	cpusetCpus := flag.String("cpuset-cpus", "",
+		"CPUs to restrict the run to, e.g. \"0-3,7\" (empty means unset)")
+	cpusetMems := flag.String("cpuset-mems", "",
+		"Memory nodes to restrict the run to (empty means unset)")
+	var hugetlbLimits repeatableFlag
+	flag.Var(&hugetlbLimits, "hugetlb-limit",
+		"Huge page limit as SIZE=BYTES, e.g. \"2MB=1073741824\" (repeatable)")
+	var deviceRules []rawDeviceRule
+	flag.Var(&deviceRuleFlag{rules: &deviceRules, allow: true}, "device-allow",
+		`Device rule to allow, as "type major:minor rwm" (repeatable). On cgroups v2 this only works if a legacy "devices" controller happens to be co-mounted; there is no eBPF-based enforcement yet, so it is effectively unsupported on v2-only hosts.`)
+	flag.Var(&deviceRuleFlag{rules: &deviceRules, allow: false}, "device-deny",
+		`Device rule to deny, as "type major:minor rwm" (repeatable). Same cgroups v2 caveat as -device-allow.`)
 	flag.Parse()
 	flagVerbose = *verbose
+	flagDriver = *driver
+	flagMetricsAddr = *metricsAddr
+
+	if flagDriver == "native" && !isCgroupsAvailable() {
+		user, err := user.Current()
+		if err != nil {
+			panic(errors.New("Can't get current user"))
+		}
+		fmt.Fprintf(os.Stderr, "cgroups is not available. Maybe you should run:\n\n\t# cgcreate -a %s -t %s -g %s:%s\n\nto create the parent cgroup.\n", user.Username, user.Username, strings.Join(cgroup.Controllers, ","), parentCgroup)
+		os.Exit(1)
+	}
+
+	if flagMetricsAddr != "" {
+		http.Handle("/metrics", promhttp.Handler())
+		go func() {
+			if err := http.ListenAndServe(flagMetricsAddr, nil); err != nil {
+				fmt.Fprintf(os.Stderr, "metrics server: %s\n", err)
+			}
+		}()
+	}
 
 	if *showStatus {
 		if err = printStatus(); err != nil {
@@ -260,7 +319,35 @@ func main() {
 		fmt.Fprintf(os.Stderr, "I/O Weight:\t%d\n", *ioWeight)
 	}
 
-	if err = doRun(*ncores, *memmb, *ioWeight); err != nil {
+	hugetlb := make(map[string]int64, len(hugetlbLimits))
+	for _, s := range hugetlbLimits {
+		size, limit, err := parseHugetlbLimit(s)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		hugetlb[size] = limit
+	}
+
+	var devices []cgroup.DeviceRule
+	for _, raw := range deviceRules {
+		rule, err := parseDeviceRule(raw.spec, raw.allow)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		devices = append(devices, rule)
+	}
+
+	extra := cgroup.Resources{
+		PidsMax:    *pidsMax,
+		CpusetCpus: *cpusetCpus,
+		CpusetMems: *cpusetMems,
+		Hugetlb:    hugetlb,
+		Devices:    devices,
+	}
+
+	if err = doRun(*ncores, *memmb, *ioWeight, extra); err != nil {
 		panic(err)
 	}
 }